@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kuangcp/logger"
+)
+
+// chainBarWidth is the total column width of the stacked bar renderChainBar
+// draws; segment widths are this many characters times each phase's share of
+// the chain's total time.
+const chainBarWidth = 60
+
+// chainBarPhases names the five Timings phases renderChainBar stacks, in
+// display order, each paired with the colorizer used for its segment and
+// legend entry -- dns=cyan, tcp=green, tls=yellow, server=magenta,
+// transfer=blue.
+var chainBarPhases = []struct {
+	name    string
+	ms      func(Timings) float64
+	colorer func(string, ...interface{}) string
+}{
+	{"dns", func(t Timings) float64 { return t.DNSMs }, color.CyanString},
+	{"tcp", func(t Timings) float64 { return t.TCPMs }, color.GreenString},
+	{"tls", func(t Timings) float64 { return t.TLSMs }, color.YellowString},
+	{"server", func(t Timings) float64 { return t.ServerMs }, color.MagentaString},
+	{"transfer", func(t Timings) float64 { return t.TransferMs }, color.BlueString},
+}
+
+// HopResult is the measurement of a single hop in a --trace-chain run: same
+// shape as one row of Result's Timings, plus the bits that vary hop to hop
+// (method, URL, status, remote address, TLS version).
+type HopResult struct {
+	Hop        int    `json:"hop"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	TLSVersion string `json:"tls_version,omitempty"`
+
+	Timings Timings `json:"timings"`
+}
+
+// ChainResult is the --output-format json/ndjson representation of a
+// --trace-chain run: every hop plus the summed totals row also printed by
+// the text table.
+type ChainResult struct {
+	Hops   []HopResult `json:"hops"`
+	Totals Timings     `json:"totals"`
+}
+
+// traceChainVisit follows target through up to maxRedirects redirects, recording
+// a HopResult per hop instead of printing an independent diagram for each
+// one as visit's own -L recursion does, then renders the whole chain as a
+// single table plus a combined stacked bar. 307/308 replay the original
+// method and body; every other redirect status falls back to a bodyless
+// GET, matching net/http.Client's own default redirect policy.
+func traceChainVisit(target *url.URL) {
+	var hops []HopResult
+
+	method := httpMethod
+	body := postBody
+	current := target
+
+	for hop := 1; ; hop++ {
+		req := newRequest(method, current, body)
+
+		times := &traceTimes{}
+		req = req.WithContext(httptrace.WithClientTrace(context.Background(), newTimingTrace(times, false)))
+
+		tr := buildTransport(current.Scheme, req.Host, nil)
+		client := &http.Client{
+			Transport: tr,
+			Timeout:   time.Second * time.Duration(requestTimeout),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Fatal("failed to read response: %v", err)
+		}
+
+		readResponseBody(req, resp)
+		resp.Body.Close()
+
+		t7 := time.Now()
+		if times.t0.IsZero() {
+			times.t0 = times.t1
+		}
+
+		hr := HopResult{
+			Hop:        hop,
+			Method:     method,
+			URL:        current.String(),
+			StatusCode: resp.StatusCode,
+			RemoteAddr: times.remoteAddr,
+			Timings:    buildTimings(times, t7),
+		}
+		if resp.TLS != nil {
+			hr.TLSVersion = tlsVersionName(resp.TLS.Version)
+		}
+		hops = append(hops, hr)
+
+		if !isRedirect(resp) {
+			break
+		}
+
+		loc, err := resp.Location()
+		if err != nil {
+			if err == http.ErrNoLocation {
+				break
+			}
+			logger.Fatal("unable to follow redirect: %v", err)
+		}
+
+		if hop > maxRedirects {
+			// A pathological redirect loop is exactly what --trace-chain exists
+			// to diagnose, so render the chain collected so far instead of
+			// aborting with no output.
+			logger.Error("maximum number of redirects (%d) followed; rendering the chain collected so far", maxRedirects)
+			break
+		}
+
+		switch resp.StatusCode {
+		case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			// method and body are preserved across 307/308.
+		default:
+			method = http.MethodGet
+			body = ""
+		}
+
+		current = loc
+	}
+
+	if outputFormat == "text" {
+		renderChainText(hops)
+	} else {
+		renderChainJSON(hops)
+	}
+}
+
+// renderChainJSON marshals every hop plus the summed totals row per
+// --output-format (json or ndjson), mirroring renderResult's behavior for a
+// single-shot visit.
+func renderChainJSON(hops []HopResult) {
+	var totals Timings
+	for _, h := range hops {
+		totals.DNSMs += h.Timings.DNSMs
+		totals.TCPMs += h.Timings.TCPMs
+		totals.TLSMs += h.Timings.TLSMs
+		totals.ServerMs += h.Timings.ServerMs
+		totals.TransferMs += h.Timings.TransferMs
+		totals.TotalMs += h.Timings.TotalMs
+	}
+
+	result := ChainResult{Hops: hops, Totals: totals}
+
+	var (
+		b   []byte
+		err error
+	)
+	if outputFormat == "ndjson" {
+		b, err = json.Marshal(result)
+	} else {
+		b, err = json.MarshalIndent(result, "", "  ")
+	}
+	if err != nil {
+		logger.Error("unable to marshal chain result: %v", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// renderChainText prints one row per hop, a totals row summing every phase,
+// and a combined stacked bar for the whole chain.
+func renderChainText(hops []HopResult) {
+	fmt.Println()
+	printf("%s\n", color.GreenString("hop  method  status  remote                 tls       dns     tcp     tls     server  transfer  total"))
+
+	var totals Timings
+	for _, h := range hops {
+		printf("%-4d %-7s %s    %-22s %-9s %6.1fms %6.1fms %6.1fms %6.1fms %7.1fms %7.1fms\n",
+			h.Hop, h.Method, statusColor(h.StatusCode)("%-6d", h.StatusCode), h.RemoteAddr, emptyDash(h.TLSVersion),
+			h.Timings.DNSMs, h.Timings.TCPMs, h.Timings.TLSMs, h.Timings.ServerMs, h.Timings.TransferMs, h.Timings.TotalMs)
+
+		totals.DNSMs += h.Timings.DNSMs
+		totals.TCPMs += h.Timings.TCPMs
+		totals.TLSMs += h.Timings.TLSMs
+		totals.ServerMs += h.Timings.ServerMs
+		totals.TransferMs += h.Timings.TransferMs
+		totals.TotalMs += h.Timings.TotalMs
+	}
+	printf("%-4s %-7s %-6s  %-22s %-9s %6.1fms %6.1fms %6.1fms %6.1fms %7.1fms %7.1fms\n",
+		"", "", "", "TOTAL", "", totals.DNSMs, totals.TCPMs, totals.TLSMs, totals.ServerMs, totals.TransferMs, totals.TotalMs)
+
+	renderChainBar(totals)
+}
+
+// renderChainBar prints a single block-character bar for the whole chain,
+// stacking all five phases across chainBarWidth columns in proportion to
+// their share of the combined total (server+transfer+... across every hop),
+// followed by a legend giving each phase's absolute time -- the "combined
+// stacked bar" showing where time was spent across the full redirect chain.
+func renderChainBar(totals Timings) {
+	sum := totals.DNSMs + totals.TCPMs + totals.TLSMs + totals.ServerMs + totals.TransferMs
+	if sum <= 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Print("[")
+	used := 0
+	for i, phase := range chainBarPhases {
+		width := int(math.Round(phase.ms(totals) / sum * chainBarWidth))
+		if i == len(chainBarPhases)-1 {
+			width = chainBarWidth - used
+		}
+		if width < 0 {
+			width = 0
+		}
+		used += width
+		printf("%s", phase.colorer(strings.Repeat("█", width)))
+	}
+	fmt.Println("]")
+
+	legend := make([]string, len(chainBarPhases))
+	for i, phase := range chainBarPhases {
+		legend[i] = phase.colorer("%s=%dms", phase.name, int(phase.ms(totals)))
+	}
+	printf("%s\n", strings.Join(legend, "  "))
+}
+
+func statusColor(code int) func(string, ...interface{}) string {
+	switch {
+	case code >= 400:
+		return color.RedString
+	case code >= 300:
+		return color.YellowString
+	default:
+		return color.GreenString
+	}
+}
+
+func emptyDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
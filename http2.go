@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/net/http2"
+)
+
+const http2Template = `` +
+	`  Conn Reuse   SETTINGS   HEADERS   DATA   Total` + "\n" +
+	`[%s  ┃   %s  ┃  %s  ┃ %s ┃ %s]` + "\n"
+
+// h2FrameTimes holds the time the first SETTINGS, HEADERS and DATA frame was
+// read off the wire for one HTTP/2 request, captured by frameTimingConn.
+type h2FrameTimes struct {
+	settings time.Time
+	headers  time.Time
+	data     time.Time
+}
+
+type h2FramesContextKey struct{}
+
+func withH2Frames(ctx context.Context, ft *h2FrameTimes) context.Context {
+	return context.WithValue(ctx, h2FramesContextKey{}, ft)
+}
+
+func h2FramesFromContext(ctx context.Context) *h2FrameTimes {
+	ft, _ := ctx.Value(h2FramesContextKey{}).(*h2FrameTimes)
+	return ft
+}
+
+// HTTP/2 frame type identifiers, RFC 7540 section 11.2.
+const (
+	h2FrameData     = 0x0
+	h2FrameHeaders  = 0x1
+	h2FrameSettings = 0x4
+)
+
+// frameScanner is a minimal streaming parser over a decrypted HTTP/2 byte
+// stream: it tracks just enough of the 9-byte frame header (length + type)
+// to call onFrame the first time each frame type of interest is seen, then
+// skips the frame body. It does not need to understand frame semantics
+// beyond that.
+type frameScanner struct {
+	header        [9]byte
+	headerFilled  int
+	bodyRemaining int
+	onFrame       func(frameType byte, at time.Time)
+}
+
+func (s *frameScanner) feed(data []byte, at time.Time) {
+	for len(data) > 0 {
+		if s.bodyRemaining > 0 {
+			n := s.bodyRemaining
+			if n > len(data) {
+				n = len(data)
+			}
+			data = data[n:]
+			s.bodyRemaining -= n
+			continue
+		}
+
+		n := copy(s.header[s.headerFilled:], data)
+		s.headerFilled += n
+		data = data[n:]
+
+		if s.headerFilled == len(s.header) {
+			length := int(s.header[0])<<16 | int(s.header[1])<<8 | int(s.header[2])
+			frameType := s.header[3]
+			s.onFrame(frameType, at)
+			s.bodyRemaining = length
+			s.headerFilled = 0
+		}
+	}
+}
+
+// frameTimingConn wraps a net.Conn that already speaks decrypted HTTP/2
+// (i.e. the *tls.Conn returned after the TLS handshake) and feeds every Read
+// through a frameScanner, recording when SETTINGS/HEADERS/DATA first appear.
+type frameTimingConn struct {
+	net.Conn
+	scanner *frameScanner
+}
+
+func newFrameTimingConn(conn net.Conn, ft *h2FrameTimes) *frameTimingConn {
+	return &frameTimingConn{
+		Conn: conn,
+		scanner: &frameScanner{
+			onFrame: func(frameType byte, at time.Time) {
+				switch frameType {
+				case h2FrameSettings:
+					if ft.settings.IsZero() {
+						ft.settings = at
+					}
+				case h2FrameHeaders:
+					if ft.headers.IsZero() {
+						ft.headers = at
+					}
+				case h2FrameData:
+					if ft.data.IsZero() {
+						ft.data = at
+					}
+				}
+			},
+		},
+	}
+}
+
+func (c *frameTimingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.scanner.feed(p[:n], time.Now())
+	}
+	return n, err
+}
+
+// attemptHTTP2 runs req over a standalone, frame-instrumented http2.Transport
+// instead of the usual http.Transport, so the first SETTINGS/HEADERS/DATA
+// frame can be timestamped. DNS/TCP/TLS are still captured via the same
+// httptrace.ClientTrace as a normal visit, fired manually from dialTLS since
+// a standalone http2.Transport dials outside of http.Transport's own hooks.
+// http2.Transport only speaks h2, so callers should fall back to the regular
+// client on error (e.g. the server doesn't support h2 at all).
+func attemptHTTP2(req *http.Request, target *url.URL, times *traceTimes) (*http.Response, *h2FrameTimes, error) {
+	ft := &h2FrameTimes{}
+
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: insecure,
+		Certificates:       readClientCert(clientCertFile),
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         []string{"h2"},
+	}
+
+	tr := &http2.Transport{
+		TLSClientConfig: tlsConfig,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			trace := httptrace.ContextClientTrace(ctx)
+
+			// A standalone http2.Transport does all of DNS resolution and the
+			// TCP dial inside net.Dialer.DialContext below, with no separate
+			// hook for either step, so DNS and TCP connect can't be told apart
+			// here the way the regular http.Transport path can. Fire both
+			// pairs of trace callbacks back-to-back around the single call so
+			// times.t0 (DNSStart) is a real timestamp instead of the zero
+			// time.Time, which is what renderHTTP2/buildTimings subtract from.
+			if trace != nil && trace.DNSStart != nil {
+				trace.DNSStart(httptrace.DNSStartInfo{Host: addr})
+			}
+			if trace != nil && trace.DNSDone != nil {
+				trace.DNSDone(httptrace.DNSDoneInfo{})
+			}
+			if trace != nil && trace.ConnectStart != nil {
+				trace.ConnectStart(network, addr)
+			}
+
+			dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+			rawConn, err := dialer.DialContext(ctx, network, addr)
+			if trace != nil && trace.ConnectDone != nil {
+				trace.ConnectDone(network, addr, err)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if trace != nil && trace.TLSHandshakeStart != nil {
+				trace.TLSHandshakeStart()
+			}
+			tlsConn := tls.Client(rawConn, cfg)
+			err = tlsConn.HandshakeContext(ctx)
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+			}
+			if err != nil {
+				rawConn.Close()
+				return nil, err
+			}
+			if trace != nil && trace.GotConn != nil {
+				trace.GotConn(httptrace.GotConnInfo{Conn: tlsConn})
+			}
+
+			return newFrameTimingConn(tlsConn, h2FramesFromContext(ctx)), nil
+		},
+	}
+
+	ctx := httptrace.WithClientTrace(context.Background(), newTimingTrace(times, outputFormat == "text"))
+	ctx = withH2Frames(ctx, ft)
+	req = req.WithContext(ctx)
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, ft, nil
+}
+
+// renderHTTP2 prints the "Connected via"/status/headers block shared with
+// renderText, then the h2-specific frame-timing template: it replaces the
+// DNS/TCP/TLS ladder with a single "Conn Reuse" flag (multiplexed connections
+// make that ladder meaningless past the first request) and shows frame-level
+// timing instead.
+func renderHTTP2(resp *http.Response, times *traceTimes, ft *h2FrameTimes, t7 time.Time) {
+	printConnectedVia(resp)
+	printStatusAndHeaders(resp)
+
+	reuse := "fresh"
+	if times.reused {
+		reuse = "reused"
+	}
+
+	blockFmt := func(d time.Duration) string {
+		return color.CyanString("%6dms", int(d/time.Millisecond))
+	}
+
+	// frameFmt reports "n/a" rather than a frame time relative to the zero
+	// time.Time: a response with no body (HEAD, 204) never gets a DATA
+	// frame, and unframed callers (the default ALPN-negotiated-h2 path, which
+	// has no frame-level instrumentation) leave every frame time zero.
+	frameFmt := func(at time.Time) string {
+		if at.IsZero() {
+			return color.CyanString("%8s", "n/a")
+		}
+		return color.CyanString("%6dms", int(at.Sub(times.t0)/time.Millisecond))
+	}
+
+	fmt.Println()
+	printf(http2Template,
+		color.CyanString("%7s", reuse),
+		frameFmt(ft.settings),
+		frameFmt(ft.headers),
+		frameFmt(ft.data),
+		blockFmt(t7.Sub(times.t0)),
+	)
+}
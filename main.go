@@ -16,13 +16,12 @@ import (
 	"os"
 	"path"
 	"runtime"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/kuangcp/logger"
 
+	ntlmssp "github.com/Azure/go-ntlmssp"
 	"github.com/fatih/color"
 )
 
@@ -64,14 +63,39 @@ var (
 
 	requestTimeout int
 
+	// ping mode flags
+	pingCount    int
+	pingInterval time.Duration
+	keepAlive    bool
+
+	// TOFU (trust on first use) certificate pinning flags
+	tofuEnabled   bool
+	tofuFile      string
+	tofuResetHost string
+
+	// negotiate auth flags
+	negotiateAuth bool
+	ntlmCreds     string
+
+	// output sink
+	outputFormat string
+
+	// HTTP/3 flag
+	http3Enabled bool
+
+	// HTTP/2 frame-level instrumentation flag
+	http2FramesEnabled bool
+
 	// number of redirects followed
 	redirectsFollowed int
+	maxRedirects      int
+
+	// chain-visit mode
+	traceChain bool
 
 	version = "devel" // for -v flag, updated during the release process with -ldflags=-X=main.version=...
 )
 
-const maxRedirects = 10
-
 func init() {
 	logger.SetLogPathTrim("httpstat/")
 
@@ -90,6 +114,27 @@ func init() {
 
 	flag.IntVar(&requestTimeout, "m", 10, "Maximum  time  in  seconds  that you allow httpstat's connection to take")
 
+	flag.IntVar(&pingCount, "c", 0, "ping mode: number of sequential requests to issue against the url, then print aggregate stats")
+	flag.DurationVar(&pingInterval, "i", time.Second, "ping mode: interval between requests, e.g. 500ms, 2s")
+	// -k is already taken by -k/insecure above, so the keepalive toggle is long-flag only.
+	flag.BoolVar(&keepAlive, "keepalive", false, "ping mode: reuse one http.Transport across requests instead of dialing fresh each time")
+
+	flag.BoolVar(&tofuEnabled, "tofu", false, "pin the server certificate on first use and detect changes on later connections")
+	flag.StringVar(&tofuFile, "tofu-file", "", "path to the TOFU pin store (default $XDG_DATA_HOME/httpstat/tofu.txt)")
+	flag.StringVar(&tofuResetHost, "tofu-reset", "", "forget the pinned fingerprint for host[:port] and exit")
+
+	flag.BoolVar(&negotiateAuth, "negotiate", false, "retry with Kerberos/SPNEGO \"Authorization: Negotiate\" when the server challenges with 401")
+	flag.StringVar(&ntlmCreds, "ntlm", "", "authenticate using NTLM with credentials in the form user:pass")
+
+	flag.StringVar(&outputFormat, "output-format", "text", "output sink: text (ASCII diagram), json, or ndjson")
+
+	flag.BoolVar(&http3Enabled, "http3", false, "use HTTP/3 (QUIC) instead of HTTP/2, falling back to h2/h1 if the server doesn't speak it")
+
+	flag.BoolVar(&http2FramesEnabled, "http2-frames", false, "show frame-level HTTP/2 timing (Conn Reuse/SETTINGS/HEADERS/DATA) alongside the normal status line and headers")
+
+	flag.IntVar(&maxRedirects, "max-redirects", 10, "maximum number of redirects to follow (-L) or trace (--trace-chain)")
+	flag.BoolVar(&traceChain, "trace-chain", false, "follow the full redirect chain and print one combined table/diagram for it, instead of one diagram per hop")
+
 	flag.Usage = usage
 }
 
@@ -126,6 +171,13 @@ func main() {
 		os.Exit(-1)
 	}
 
+	switch outputFormat {
+	case "text", "json", "ndjson":
+	default:
+		fmt.Fprintf(os.Stderr, "%s: --output-format must be one of text, json, ndjson\n", os.Args[0])
+		os.Exit(-1)
+	}
+
 	args := flag.Args()
 	if len(args) != 1 {
 		flag.Usage()
@@ -140,6 +192,21 @@ func main() {
 		httpMethod = "HEAD"
 	}
 
+	if tofuResetHost != "" {
+		resetTofuPin(tofuResetHost)
+		return
+	}
+
+	if pingCount > 0 {
+		pingVisit(parseURL(args[0]))
+		return
+	}
+
+	if traceChain {
+		traceChainVisit(parseURL(args[0]))
+		return
+	}
+
 	visit(parseURL(args[0]))
 }
 
@@ -219,40 +286,68 @@ func dialContext(network string) func(ctx context.Context, network, addr string)
 	}
 }
 
-// visit visits a url and times the interaction.
-// If the response is a 30x, visit follows the redirect.
-func visit(url *url.URL) {
-	req := newRequest(httpMethod, url, postBody)
-
-	var t0, t1, t2, t3, t4, t5, t6 time.Time
+// traceTimes holds the t0..t6 checkpoints captured by an httptrace.ClientTrace.
+// t7 (end of body read) is recorded separately once the response is fully read.
+// reused/wasIdle come from GotConnInfo and distinguish a pooled connection
+// (ping mode's dns/conn/tls fields read "reused") from a freshly dialed one. remoteAddr
+// is the actual dialed peer (from GotConnInfo.Conn), not the request's
+// hostname[:port].
+type traceTimes struct {
+	t0, t1, t2, t3, t4, t5, t6 time.Time
+	reused, wasIdle            bool
+	remoteAddr                 string
+}
 
-	trace := &httptrace.ClientTrace{
-		DNSStart: func(_ httptrace.DNSStartInfo) { t0 = time.Now() },
-		DNSDone:  func(_ httptrace.DNSDoneInfo) { t1 = time.Now() },
+// newTimingTrace builds an httptrace.ClientTrace that records t0..t6 into times.
+// When verbose is true it also prints the "Connected to" line as soon as the
+// TCP connection completes, matching the single-shot visit output; ping mode
+// passes verbose=false to keep its one-line-per-request summary uncluttered.
+func newTimingTrace(times *traceTimes, verbose bool) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) { times.t0 = time.Now() },
+		DNSDone:  func(_ httptrace.DNSDoneInfo) { times.t1 = time.Now() },
 		ConnectStart: func(_, _ string) {
-			if t1.IsZero() {
+			if times.t1.IsZero() {
 				// connecting to IP
-				t1 = time.Now()
+				times.t1 = time.Now()
 			}
 		},
 		ConnectDone: func(net, addr string, err error) {
 			// TODO print timeout, also print tree
 			if err != nil {
-				fmt.Printf("     DNS Lookup: %v\n TCP Connection: %v\n", t1.Sub(t0), time.Now().Sub(t1))
-				logger.Error("unable to connect to host %v: %v", addr, err)
+				if verbose {
+					fmt.Printf("     DNS Lookup: %v\n TCP Connection: %v\n", times.t1.Sub(times.t0), time.Now().Sub(times.t1))
+					logger.Error("unable to connect to host %v: %v", addr, err)
+				}
 				return
 			}
-			t2 = time.Now()
+			times.t2 = time.Now()
 
-			printf("\n%s%s\n", color.GreenString("Connected to "), color.CyanString(addr))
+			if verbose {
+				printf("\n%s%s\n", color.GreenString("Connected to "), color.CyanString(addr))
+			}
 		},
-		GotConn:              func(_ httptrace.GotConnInfo) { t3 = time.Now() },
-		GotFirstResponseByte: func() { t4 = time.Now() },
-		TLSHandshakeStart:    func() { t5 = time.Now() },
-		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { t6 = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			times.t3 = time.Now()
+			times.reused = info.Reused
+			times.wasIdle = info.WasIdle
+			if info.Conn != nil {
+				times.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		GotFirstResponseByte: func() { times.t4 = time.Now() },
+		TLSHandshakeStart:    func() { times.t5 = time.Now() },
+		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { times.t6 = time.Now() },
 	}
-	req = req.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+}
 
+// buildTransport creates the *http.Transport used for a single httpstat
+// request, wired up for the -4/-6 dial restriction and, for https URLs,
+// client-cert/TLS configuration for reqHost. tofuStatus, if non-nil and
+// --tofu is enabled, is filled in by the TOFU verify callback with the pin
+// outcome so the caller can surface it in a Result; callers that don't build
+// a Result (ping, --trace-chain) pass nil.
+func buildTransport(scheme, reqHost string, tofuStatus *TOFUStatus) *http.Transport {
 	tr := &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		MaxIdleConns:          100,
@@ -269,11 +364,11 @@ func visit(url *url.URL) {
 		tr.DialContext = dialContext("tcp6")
 	}
 
-	switch url.Scheme {
+	switch scheme {
 	case "https":
-		host, _, err := net.SplitHostPort(req.Host)
+		host, _, err := net.SplitHostPort(reqHost)
 		if err != nil {
-			host = req.Host
+			host = reqHost
 		}
 
 		tr.TLSClientConfig = &tls.Config{
@@ -282,10 +377,103 @@ func visit(url *url.URL) {
 			Certificates:       readClientCert(clientCertFile),
 			MinVersion:         tls.VersionTLS12,
 		}
+
+		if tofuEnabled {
+			hostport := reqHost
+			if _, _, err := net.SplitHostPort(hostport); err != nil {
+				hostport = net.JoinHostPort(hostport, "443")
+			}
+
+			// VerifyPeerCertificate becomes the sole authority on whether the
+			// handshake is trusted, so regular chain verification is disabled.
+			tr.TLSClientConfig.InsecureSkipVerify = true
+			tr.TLSClientConfig.VerifyPeerCertificate = tofuVerifyPeerCertificate(hostport, tofuStatus)
+		}
+	}
+
+	return tr
+}
+
+// simpleFeaturesOnly reports whether none of the TOFU/negotiate/NTLM flags
+// are in play, so the opt-in standalone-HTTP/2 (--http2-frames) and HTTP/3
+// (--http3) paths (which don't know how to combine with those) are safe to
+// try.
+func simpleFeaturesOnly() bool {
+	return !tofuEnabled && !negotiateAuth && ntlmCreds == ""
+}
+
+// visit visits a url and times the interaction.
+// If the response is a 30x, visit follows the redirect.
+func visit(url *url.URL) {
+	if http3Enabled && url.Scheme == "https" && simpleFeaturesOnly() {
+		req := newRequest(httpMethod, url, postBody)
+		if resp, qt, _, err := attemptHTTP3(req, url); err == nil {
+			bodyMsg := readResponseBody(req, resp)
+			resp.Body.Close()
+			t7 := time.Now() // after read body
+			if outputFormat == "text" {
+				renderHTTP3(qt, t7)
+				if bodyMsg != "" {
+					printf("\n%s\n", bodyMsg)
+				}
+			} else {
+				renderResult(buildHTTP3Result(url, req, resp, qt, t7))
+			}
+			return
+		}
+		// HTTP/3 unreachable (server doesn't speak QUIC, UDP blocked, ...);
+		// fall through to h2/h1 below.
+	}
+
+	if http2FramesEnabled && url.Scheme == "https" && simpleFeaturesOnly() {
+		req := newRequest(httpMethod, url, postBody)
+		h2times := &traceTimes{}
+		if resp, ft, err := attemptHTTP2(req, url, h2times); err == nil {
+			bodyMsg := readResponseBody(req, resp)
+			resp.Body.Close()
+			t7 := time.Now()
+
+			if outputFormat == "text" {
+				renderHTTP2(resp, h2times, ft, t7)
+				if bodyMsg != "" {
+					printf("\n%s\n", bodyMsg)
+				}
+			} else {
+				renderResult(buildResult(url, req, resp, h2times, t7))
+			}
+			return
+		}
+		// Server doesn't support h2 (or the attempt otherwise failed); fall
+		// back to the regular http.Transport path below, which still
+		// negotiates h2 via ALPN but without frame-level instrumentation.
+	}
+
+	req := newRequest(httpMethod, url, postBody)
+
+	times := &traceTimes{}
+	req = req.WithContext(httptrace.WithClientTrace(context.Background(), newTimingTrace(times, outputFormat == "text")))
+
+	var tofuStatus *TOFUStatus
+	if tofuEnabled {
+		tofuStatus = &TOFUStatus{}
+	}
+	tr := buildTransport(url.Scheme, req.Host, tofuStatus)
+
+	if ntlmCreds != "" {
+		user, pass, ok := strings.Cut(ntlmCreds, ":")
+		if !ok {
+			logger.Fatal("--ntlm expects credentials in the form user:pass")
+		}
+		req.SetBasicAuth(user, pass)
+	}
+
+	var roundTripper http.RoundTripper = tr
+	if ntlmCreds != "" {
+		roundTripper = ntlmssp.Negotiator{RoundTripper: tr}
 	}
 
 	client := &http.Client{
-		Transport: tr,
+		Transport: roundTripper,
 		Timeout:   time.Second * time.Duration(requestTimeout),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// always refuse to follow redirects, visit does that
@@ -299,122 +487,42 @@ func visit(url *url.URL) {
 		logger.Fatal("failed to read response: %v", err)
 	}
 
-	// Print SSL/TLS version which is used for connection
-	connectedVia := "plaintext"
-	if resp.TLS != nil {
-		switch resp.TLS.Version {
-		case tls.VersionTLS12:
-			connectedVia = "TLSv1.2"
-		case tls.VersionTLS13:
-			connectedVia = "TLSv1.3"
+	if negotiateAuth && resp.StatusCode == http.StatusUnauthorized {
+		resp, times, err = retryWithNegotiate(client, url, resp, times)
+		if err != nil {
+			logger.Fatal("negotiate authentication failed: %v", err)
 		}
 	}
-	printf("\n%s %s\n", color.GreenString("Connected via"), color.CyanString("%s", connectedVia))
 
 	bodyMsg := readResponseBody(req, resp)
 	resp.Body.Close()
 
 	t7 := time.Now() // after read body
-	if t0.IsZero() {
+	if times.t0.IsZero() {
 		// we skipped DNS
-		t0 = t1
-	}
-
-	// print status line and headers
-	printf("\n%s%s%s\n", color.GreenString("HTTP"), grayscale(14)("/"),
-		color.CyanString("%d.%d %s", resp.ProtoMajor, resp.ProtoMinor, resp.Status))
-
-	names := make([]string, 0, len(resp.Header))
-	for k := range resp.Header {
-		names = append(names, k)
-	}
-	reqHeaders := headers(names)
-	sort.Slice(reqHeaders, func(i, j int) bool {
-		a, b := reqHeaders[i], reqHeaders[j]
-
-		// server always sorts at the top
-		if a == "Server" {
-			return true
-		}
-		if b == "Server" {
-			return false
-		}
-
-		endtoend := func(n string) bool {
-			// https://www.w3.org/Protocols/rfc2616/rfc2616-sec13.html#sec13.5.1
-			switch n {
-			case "Connection",
-				"Keep-Alive",
-				"Proxy-Authenticate",
-				"Proxy-Authorization",
-				"TE",
-				"Trailers",
-				"Transfer-Encoding",
-				"Upgrade":
-				return false
-			default:
-				return true
+		times.t0 = times.t1
+	}
+
+	if outputFormat == "text" {
+		if resp.Proto == "HTTP/2.0" {
+			// ALPN negotiated h2 even though --http2-frames wasn't passed, so
+			// there's no frame-level instrumentation (h2FrameTimes is left
+			// zero throughout). Render the h2 template instead of the linear
+			// DNS/TCP/TLS/server/transfer ladder: that ladder implies a
+			// single request/response stream, which isn't how h2 works.
+			renderHTTP2(resp, times, &h2FrameTimes{}, t7)
+			if bodyMsg != "" {
+				printf("\n%s\n", bodyMsg)
 			}
+		} else {
+			renderText(url, resp, times, t7, bodyMsg)
 		}
-
-		x, y := endtoend(a), endtoend(b)
-		if x == y {
-			// both are of the same class
-			return a < b
+	} else {
+		result := buildResult(url, req, resp, times, t7)
+		if tofuStatus != nil {
+			result.TOFU = tofuStatus
 		}
-		return x
-	})
-	for _, k := range names {
-		printf("%s %s\n", grayscale(14)(k+":"), color.CyanString(strings.Join(resp.Header[k], ",")))
-	}
-
-	if bodyMsg != "" {
-		printf("\n%s\n", bodyMsg)
-	}
-
-	blockFmt := func(d time.Duration) string {
-		return color.CyanString("%7dms", int(d/time.Millisecond))
-	}
-
-	flagFmt := func(d time.Duration) string {
-		return color.CyanString("%-9s", strconv.Itoa(int(d/time.Millisecond))+"ms")
-	}
-
-	colorize := func(s string) string {
-		v := strings.Split(s, "\n")
-		v[0] = grayscale(16)(v[0])
-		return strings.Join(v, "\n")
-	}
-
-	fmt.Println()
-
-	switch url.Scheme {
-	case "https":
-		printf(colorize(httpsTemplate),
-			blockFmt(t1.Sub(t0)), // dns lookup
-			blockFmt(t2.Sub(t1)), // tcp connection
-			blockFmt(t6.Sub(t5)), // tls handshake
-			blockFmt(t4.Sub(t3)), // server processing
-			blockFmt(t7.Sub(t4)), // content transfer
-
-			flagFmt(t1.Sub(t0)), // namelookup
-			flagFmt(t2.Sub(t0)), // connect
-			flagFmt(t3.Sub(t0)), // pretransfer
-			flagFmt(t4.Sub(t0)), // starttransfer
-			flagFmt(t7.Sub(t0)), // total
-		)
-	case "http":
-		printf(colorize(httpTemplate),
-			blockFmt(t1.Sub(t0)), // dns lookup
-			blockFmt(t3.Sub(t1)), // tcp connection
-			blockFmt(t4.Sub(t3)), // server processing
-			blockFmt(t7.Sub(t4)), // content transfer
-
-			flagFmt(t1.Sub(t0)), // namelookup
-			flagFmt(t3.Sub(t0)), // connect
-			flagFmt(t4.Sub(t0)), // starttransfer
-			flagFmt(t7.Sub(t0)), // total
-		)
+		renderResult(result)
 	}
 
 	if followRedirects && isRedirect(resp) {
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kuangcp/logger"
+)
+
+// pingPhase is a single timed request issued by pingVisit. reused mirrors
+// traceTimes.reused: on a pooled connection net/http only fires
+// GotConn/GotFirstResponseByte, so dns/connect/tls are meaningless (left
+// zero) and ttfb/total are baselined off GotConn instead of DNSStart.
+type pingPhase struct {
+	seq     int
+	status  int
+	err     error
+	reused  bool
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	ttfb    time.Duration
+	total   time.Duration
+}
+
+// pingStats accumulates every pingPhase's per-phase durations, plus
+// status-class and error counts, ready to be reduced into a pingSummary by
+// summary(). dns/connect/tls only collect fresh-connection samples, since a
+// reused one never measures them.
+type pingStats struct {
+	dns       []time.Duration
+	connect   []time.Duration
+	tls       []time.Duration
+	ttfb      []time.Duration
+	totals    []time.Duration
+	status2xx int
+	status3xx int
+	status4xx int
+	status5xx int
+	errors    int
+}
+
+func (s *pingStats) record(p pingPhase) {
+	if p.err != nil {
+		s.errors++
+		return
+	}
+	if !p.reused {
+		s.dns = append(s.dns, p.dns)
+		s.connect = append(s.connect, p.connect)
+		s.tls = append(s.tls, p.tls)
+	}
+	s.ttfb = append(s.ttfb, p.ttfb)
+	s.totals = append(s.totals, p.total)
+	switch {
+	case p.status >= 200 && p.status < 300:
+		s.status2xx++
+	case p.status >= 300 && p.status < 400:
+		s.status3xx++
+	case p.status >= 400 && p.status < 500:
+		s.status4xx++
+	case p.status >= 500 && p.status < 600:
+		s.status5xx++
+	}
+}
+
+// pingVisit issues pingCount sequential requests to url, printing a one-line
+// summary per request, and prints aggregate latency statistics at the end.
+// It suppresses the pretty ASCII diagram used by a single-shot visit. If
+// keepAlive is set, one *http.Transport (and its connection pool) is reused
+// across every iteration so cold vs warm connection cost can be compared.
+func pingVisit(target *url.URL) {
+	var tr *http.Transport
+	if keepAlive {
+		tr = buildTransport(target.Scheme, target.Host, nil)
+	}
+
+	stats := &pingStats{}
+
+	// ctx is cancelled on SIGINT, which is threaded through to the in-flight
+	// request (see doPingRequest) so a Ctrl-C lands immediately instead of
+	// only being noticed between iterations or during the interval sleep.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if outputFormat == "text" {
+		printf("PING %s (%d requests, interval %s, keepalive=%v)\n", target.String(), pingCount, pingInterval, keepAlive)
+	}
+
+	for seq := 1; seq <= pingCount; seq++ {
+		if ctx.Err() != nil {
+			finishPing(stats)
+			return
+		}
+
+		phase := doPingRequest(ctx, seq, target, tr)
+		stats.record(phase)
+		if outputFormat == "text" {
+			printPingLine(phase)
+		} else {
+			renderPingLineJSON(phase)
+		}
+
+		if seq < pingCount {
+			select {
+			case <-ctx.Done():
+				finishPing(stats)
+				return
+			case <-time.After(pingInterval):
+			}
+		}
+	}
+
+	finishPing(stats)
+}
+
+// finishPing renders the aggregate summary in whichever sink --output-format
+// selects, whether the run completed or SIGINT cut it short.
+func finishPing(stats *pingStats) {
+	if outputFormat == "text" {
+		printPingSummary(stats)
+	} else {
+		renderPingSummaryJSON(stats)
+	}
+}
+
+// doPingRequest performs a single iteration of ping mode, capturing the same
+// t0..t7 checkpoints as a normal visit via httptrace.ClientTrace. When tr is
+// non-nil (keepalive mode) it is reused; otherwise a fresh transport (and
+// thus a fresh connection) is built for every iteration, and closed before
+// returning so its pooled idle connection doesn't linger for the
+// IdleConnTimeout window. ctx is cancelled on SIGINT so a request in flight
+// when the user hits Ctrl-C is aborted rather than run to completion.
+func doPingRequest(ctx context.Context, seq int, target *url.URL, tr *http.Transport) pingPhase {
+	req := newRequest(httpMethod, target, postBody)
+
+	times := &traceTimes{}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, newTimingTrace(times, false)))
+
+	iterTr := tr
+	if iterTr == nil {
+		iterTr = buildTransport(target.Scheme, req.Host, nil)
+		defer iterTr.CloseIdleConnections()
+	}
+
+	client := &http.Client{
+		Transport: iterTr,
+		Timeout:   time.Second * time.Duration(requestTimeout),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return pingPhase{seq: seq, err: err}
+	}
+	defer resp.Body.Close()
+
+	readResponseBody(req, resp)
+	t7 := time.Now()
+
+	if times.reused {
+		// Pooled connection: DNSStart/ConnectStart/TLSHandshakeStart never
+		// fire again, so t0/t1/t2/t5/t6 are all still the zero time.Time.
+		// Baseline off t3 (GotConn) instead of subtracting from year 1.
+		return pingPhase{
+			seq:    seq,
+			status: resp.StatusCode,
+			reused: true,
+			ttfb:   times.t4.Sub(times.t3),
+			total:  t7.Sub(times.t3),
+		}
+	}
+
+	if times.t0.IsZero() {
+		times.t0 = times.t1
+	}
+
+	return pingPhase{
+		seq:     seq,
+		status:  resp.StatusCode,
+		dns:     times.t1.Sub(times.t0),
+		connect: times.t2.Sub(times.t0),
+		tls:     times.t6.Sub(times.t5),
+		ttfb:    times.t4.Sub(times.t0),
+		total:   t7.Sub(times.t0),
+	}
+}
+
+func printPingLine(p pingPhase) {
+	if p.err != nil {
+		printf("seq=%d %s\n", p.seq, color.RedString("error=%v", p.err))
+		return
+	}
+
+	statusColor := color.GreenString
+	if p.status >= 400 {
+		statusColor = color.RedString
+	} else if p.status >= 300 {
+		statusColor = color.YellowString
+	}
+
+	dns, conn, tls := fmtMs(p.dns), fmtMs(p.connect), fmtMs(p.tls)
+	if p.reused {
+		dns, conn, tls = "reused", "reused", "reused"
+	}
+
+	printf("seq=%d status=%s dns=%s conn=%s tls=%s ttfb=%s total=%s\n",
+		p.seq, statusColor("%d", p.status), dns, conn, tls, fmtMs(p.ttfb), fmtMs(p.total))
+}
+
+func fmtMs(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// latencyStats is the min/avg/max/stddev/percentile breakdown of one phase
+// (dns, connect, tls, ttfb, or total) across a ping run.
+type latencyStats struct {
+	hasLatency bool
+	min        time.Duration
+	avg        time.Duration
+	max        time.Duration
+	stddev     time.Duration
+	p50        time.Duration
+	p90        time.Duration
+	p99        time.Duration
+}
+
+// computeLatencyStats reduces a phase's samples into a latencyStats. Samples
+// need not be sorted; it sorts its own copy.
+func computeLatencyStats(samples []time.Duration) latencyStats {
+	n := len(samples)
+	if n == 0 {
+		return latencyStats{}
+	}
+
+	sorted := make([]time.Duration, n)
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	avg := total / time.Duration(n)
+
+	var variance float64
+	for _, d := range sorted {
+		diff := float64(d - avg)
+		variance += diff * diff
+	}
+	variance /= float64(n)
+
+	percentile := func(p float64) time.Duration {
+		idx := int(math.Ceil(p/100*float64(n))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= n {
+			idx = n - 1
+		}
+		return sorted[idx]
+	}
+
+	return latencyStats{
+		hasLatency: true,
+		min:        sorted[0],
+		avg:        avg,
+		max:        sorted[n-1],
+		stddev:     time.Duration(math.Sqrt(variance)),
+		p50:        percentile(50),
+		p90:        percentile(90),
+		p99:        percentile(99),
+	}
+}
+
+// pingSummary is the aggregate status-class breakdown plus the per-phase
+// latencyStats of a ping run, shared by both the text and JSON summary
+// renderers.
+type pingSummary struct {
+	requests  int
+	succeeded int
+	errors    int
+	status2xx int
+	status3xx int
+	status4xx int
+	status5xx int
+
+	dns     latencyStats
+	connect latencyStats
+	tls     latencyStats
+	ttfb    latencyStats
+	total   latencyStats
+}
+
+func (s *pingStats) summary() pingSummary {
+	return pingSummary{
+		requests:  len(s.totals) + s.errors,
+		succeeded: len(s.totals),
+		errors:    s.errors,
+		status2xx: s.status2xx,
+		status3xx: s.status3xx,
+		status4xx: s.status4xx,
+		status5xx: s.status5xx,
+
+		dns:     computeLatencyStats(s.dns),
+		connect: computeLatencyStats(s.connect),
+		tls:     computeLatencyStats(s.tls),
+		ttfb:    computeLatencyStats(s.ttfb),
+		total:   computeLatencyStats(s.totals),
+	}
+}
+
+// printPingSummary prints min/avg/max/stddev/percentile latency stats per
+// phase plus status-class and error counts for everything recorded so far.
+// It is called both at the end of a normal run and when SIGINT interrupts
+// one early.
+func printPingSummary(stats *pingStats) {
+	s := stats.summary()
+	printf("\n--- ping statistics ---\n")
+	printf("%d requests, %d succeeded, %d errors\n", s.requests, s.succeeded, s.errors)
+	printf("status: 2xx=%d 3xx=%d 4xx=%d 5xx=%d\n", s.status2xx, s.status3xx, s.status4xx, s.status5xx)
+
+	printPhaseLatency("dns", s.dns)
+	printPhaseLatency("tcp", s.connect)
+	printPhaseLatency("tls", s.tls)
+	printPhaseLatency("ttfb", s.ttfb)
+	printPhaseLatency("total", s.total)
+}
+
+func printPhaseLatency(name string, ls latencyStats) {
+	if !ls.hasLatency {
+		return
+	}
+	printf("%-5s min=%s avg=%s max=%s stddev=%s p50=%s p90=%s p99=%s\n",
+		name, fmtMs(ls.min), fmtMs(ls.avg), fmtMs(ls.max), fmtMs(ls.stddev), fmtMs(ls.p50), fmtMs(ls.p90), fmtMs(ls.p99))
+}
+
+// pingLineJSON and pingSummaryJSON are the --output-format json/ndjson
+// representations of a single ping iteration and the final aggregate, with
+// json tags matching buildTimings' naming convention (*_ms fields).
+type pingLineJSON struct {
+	Seq     int     `json:"seq"`
+	Status  int     `json:"status,omitempty"`
+	Error   string  `json:"error,omitempty"`
+	Reused  bool    `json:"reused,omitempty"`
+	DNSMs   float64 `json:"dns_ms,omitempty"`
+	ConnMs  float64 `json:"conn_ms,omitempty"`
+	TLSMs   float64 `json:"tls_ms,omitempty"`
+	TTFBMs  float64 `json:"ttfb_ms,omitempty"`
+	TotalMs float64 `json:"total_ms,omitempty"`
+}
+
+// latencyStatsJSON is the JSON representation of one phase's latencyStats,
+// with json tags matching buildTimings' naming convention (*_ms fields).
+type latencyStatsJSON struct {
+	MinMs    float64 `json:"min_ms,omitempty"`
+	AvgMs    float64 `json:"avg_ms,omitempty"`
+	MaxMs    float64 `json:"max_ms,omitempty"`
+	StddevMs float64 `json:"stddev_ms,omitempty"`
+	P50Ms    float64 `json:"p50_ms,omitempty"`
+	P90Ms    float64 `json:"p90_ms,omitempty"`
+	P99Ms    float64 `json:"p99_ms,omitempty"`
+}
+
+func toLatencyStatsJSON(ls latencyStats) latencyStatsJSON {
+	if !ls.hasLatency {
+		return latencyStatsJSON{}
+	}
+	return latencyStatsJSON{
+		MinMs:    ms(ls.min),
+		AvgMs:    ms(ls.avg),
+		MaxMs:    ms(ls.max),
+		StddevMs: ms(ls.stddev),
+		P50Ms:    ms(ls.p50),
+		P90Ms:    ms(ls.p90),
+		P99Ms:    ms(ls.p99),
+	}
+}
+
+type pingSummaryJSON struct {
+	Summary struct {
+		Requests  int `json:"requests"`
+		Succeeded int `json:"succeeded"`
+		Errors    int `json:"errors"`
+		Status2xx int `json:"status_2xx"`
+		Status3xx int `json:"status_3xx"`
+		Status4xx int `json:"status_4xx"`
+		Status5xx int `json:"status_5xx"`
+
+		DNS     latencyStatsJSON `json:"dns"`
+		Connect latencyStatsJSON `json:"tcp"`
+		TLS     latencyStatsJSON `json:"tls"`
+		TTFB    latencyStatsJSON `json:"ttfb"`
+		Total   latencyStatsJSON `json:"total"`
+	} `json:"summary"`
+}
+
+func renderPingLineJSON(p pingPhase) {
+	line := pingLineJSON{Seq: p.seq}
+	if p.err != nil {
+		line.Error = p.err.Error()
+	} else {
+		line.Status = p.status
+		line.Reused = p.reused
+		line.DNSMs = ms(p.dns)
+		line.ConnMs = ms(p.connect)
+		line.TLSMs = ms(p.tls)
+		line.TTFBMs = ms(p.ttfb)
+		line.TotalMs = ms(p.total)
+	}
+	printJSONLine(line)
+}
+
+func renderPingSummaryJSON(stats *pingStats) {
+	s := stats.summary()
+	var out pingSummaryJSON
+	out.Summary.Requests = s.requests
+	out.Summary.Succeeded = s.succeeded
+	out.Summary.Errors = s.errors
+	out.Summary.Status2xx = s.status2xx
+	out.Summary.Status3xx = s.status3xx
+	out.Summary.Status4xx = s.status4xx
+	out.Summary.Status5xx = s.status5xx
+	out.Summary.DNS = toLatencyStatsJSON(s.dns)
+	out.Summary.Connect = toLatencyStatsJSON(s.connect)
+	out.Summary.TLS = toLatencyStatsJSON(s.tls)
+	out.Summary.TTFB = toLatencyStatsJSON(s.ttfb)
+	out.Summary.Total = toLatencyStatsJSON(s.total)
+	printJSONLine(out)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func printJSONLine(v interface{}) {
+	var (
+		b   []byte
+		err error
+	)
+	if outputFormat == "ndjson" {
+		b, err = json.Marshal(v)
+	} else {
+		b, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		logger.Error("unable to marshal ping output: %v", err)
+		return
+	}
+	fmt.Println(string(b))
+}
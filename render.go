@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// printConnectedVia prints the "Connected via" line showing the negotiated
+// TLS version (or "plaintext" for http:// targets). Shared by renderText and
+// renderHTTP2 so the h2-specific sink doesn't drop this line.
+func printConnectedVia(resp *http.Response) {
+	connectedVia := "plaintext"
+	if resp.TLS != nil {
+		switch resp.TLS.Version {
+		case tls.VersionTLS12:
+			connectedVia = "TLSv1.2"
+		case tls.VersionTLS13:
+			connectedVia = "TLSv1.3"
+		}
+	}
+	printf("\n%s %s\n", color.GreenString("Connected via"), color.CyanString("%s", connectedVia))
+}
+
+// printStatusAndHeaders prints the status line and the response headers,
+// sorted the way curl -v does (Server first, then end-to-end headers before
+// hop-by-hop ones). Shared by renderText and renderHTTP2.
+func printStatusAndHeaders(resp *http.Response) {
+	printf("\n%s%s%s\n", color.GreenString("HTTP"), grayscale(14)("/"),
+		color.CyanString("%d.%d %s", resp.ProtoMajor, resp.ProtoMinor, resp.Status))
+
+	names := make([]string, 0, len(resp.Header))
+	for k := range resp.Header {
+		names = append(names, k)
+	}
+	reqHeaders := headers(names)
+	sort.Slice(reqHeaders, func(i, j int) bool {
+		a, b := reqHeaders[i], reqHeaders[j]
+
+		// server always sorts at the top
+		if a == "Server" {
+			return true
+		}
+		if b == "Server" {
+			return false
+		}
+
+		endtoend := func(n string) bool {
+			// https://www.w3.org/Protocols/rfc2616/rfc2616-sec13.html#sec13.5.1
+			switch n {
+			case "Connection",
+				"Keep-Alive",
+				"Proxy-Authenticate",
+				"Proxy-Authorization",
+				"TE",
+				"Trailers",
+				"Transfer-Encoding",
+				"Upgrade":
+				return false
+			default:
+				return true
+			}
+		}
+
+		x, y := endtoend(a), endtoend(b)
+		if x == y {
+			// both are of the same class
+			return a < b
+		}
+		return x
+	})
+	for _, k := range names {
+		printf("%s %s\n", grayscale(14)(k+":"), color.CyanString(strings.Join(resp.Header[k], ",")))
+	}
+}
+
+// renderText is the default sink: it prints the "Connected via", status
+// line, headers, body disposition message and the ASCII timing diagram for
+// a single-shot visit. The "Connected to " line is printed earlier, from
+// within the httptrace.ClientTrace itself, as soon as the TCP connection
+// completes.
+func renderText(target *url.URL, resp *http.Response, times *traceTimes, t7 time.Time, bodyMsg string) {
+	printConnectedVia(resp)
+	printStatusAndHeaders(resp)
+
+	if bodyMsg != "" {
+		printf("\n%s\n", bodyMsg)
+	}
+
+	blockFmt := func(d time.Duration) string {
+		return color.CyanString("%7dms", int(d/time.Millisecond))
+	}
+
+	flagFmt := func(d time.Duration) string {
+		return color.CyanString("%-9s", strconv.Itoa(int(d/time.Millisecond))+"ms")
+	}
+
+	colorize := func(s string) string {
+		v := strings.Split(s, "\n")
+		v[0] = grayscale(16)(v[0])
+		return strings.Join(v, "\n")
+	}
+
+	fmt.Println()
+
+	switch target.Scheme {
+	case "https":
+		printf(colorize(httpsTemplate),
+			blockFmt(times.t1.Sub(times.t0)), // dns lookup
+			blockFmt(times.t2.Sub(times.t1)), // tcp connection
+			blockFmt(times.t6.Sub(times.t5)), // tls handshake
+			blockFmt(times.t4.Sub(times.t3)), // server processing
+			blockFmt(t7.Sub(times.t4)),       // content transfer
+
+			flagFmt(times.t1.Sub(times.t0)), // namelookup
+			flagFmt(times.t2.Sub(times.t0)), // connect
+			flagFmt(times.t3.Sub(times.t0)), // pretransfer
+			flagFmt(times.t4.Sub(times.t0)), // starttransfer
+			flagFmt(t7.Sub(times.t0)),       // total
+		)
+	case "http":
+		printf(colorize(httpTemplate),
+			blockFmt(times.t1.Sub(times.t0)), // dns lookup
+			blockFmt(times.t3.Sub(times.t1)), // tcp connection
+			blockFmt(times.t4.Sub(times.t3)), // server processing
+			blockFmt(t7.Sub(times.t4)),       // content transfer
+
+			flagFmt(times.t1.Sub(times.t0)), // namelookup
+			flagFmt(times.t3.Sub(times.t0)), // connect
+			flagFmt(times.t4.Sub(times.t0)), // starttransfer
+			flagFmt(t7.Sub(times.t0)),       // total
+		)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kuangcp/logger"
+)
+
+// Timings is the phase breakdown of a single request, in both
+// human-friendly milliseconds and the raw t0..t7 httptrace checkpoints (as
+// nanoseconds since the Unix epoch) that produced them.
+type Timings struct {
+	DNSMs      float64 `json:"dns_ms"`
+	TCPMs      float64 `json:"tcp_ms"`
+	TLSMs      float64 `json:"tls_ms"`
+	ServerMs   float64 `json:"server_ms"`
+	TransferMs float64 `json:"transfer_ms"`
+	TotalMs    float64 `json:"total_ms"`
+
+	T0 int64 `json:"t0"`
+	T1 int64 `json:"t1"`
+	T2 int64 `json:"t2"`
+	T3 int64 `json:"t3"`
+	T4 int64 `json:"t4"`
+	T5 int64 `json:"t5"`
+	T6 int64 `json:"t6"`
+	T7 int64 `json:"t7"`
+}
+
+// Result is the measurement of one request, independent of how it is
+// presented: renderResult marshals it as JSON/NDJSON for machine consumers
+// (jq, Prometheus textfile collectors, CI assertions, ...). The text sink
+// does not read a Result: renderText draws the ASCII diagram directly from
+// the response and the raw traceTimes.
+type Result struct {
+	URL        string `json:"url"`
+	Method     string `json:"method"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	TLSVersion           string   `json:"tls_version,omitempty"`
+	TLSCipher            string   `json:"tls_cipher,omitempty"`
+	PeerCertFingerprints []string `json:"peer_cert_fingerprints,omitempty"`
+
+	TOFU *TOFUStatus `json:"tofu,omitempty"`
+
+	Protocol   string      `json:"protocol"`
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Headers    http.Header `json:"headers"`
+
+	Timings Timings `json:"timings"`
+}
+
+// buildResult assembles a Result from the raw measurement of a single visit.
+func buildResult(target *url.URL, req *http.Request, resp *http.Response, times *traceTimes, t7 time.Time) Result {
+	r := Result{
+		URL:        target.String(),
+		Method:     req.Method,
+		RemoteAddr: times.remoteAddr,
+		Protocol:   resp.Proto,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Headers:    resp.Header,
+		Timings:    buildTimings(times, t7),
+	}
+
+	if resp.TLS != nil {
+		r.TLSVersion = tlsVersionName(resp.TLS.Version)
+		r.TLSCipher = tls.CipherSuiteName(resp.TLS.CipherSuite)
+		for _, cert := range resp.TLS.PeerCertificates {
+			r.PeerCertFingerprints = append(r.PeerCertFingerprints, spkiFingerprint(cert))
+		}
+	}
+
+	return r
+}
+
+func buildTimings(times *traceTimes, t7 time.Time) Timings {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+	nanos := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.UnixNano()
+	}
+
+	return Timings{
+		DNSMs:      ms(times.t1.Sub(times.t0)),
+		TCPMs:      ms(times.t2.Sub(times.t1)),
+		TLSMs:      ms(times.t6.Sub(times.t5)),
+		ServerMs:   ms(times.t4.Sub(times.t3)),
+		TransferMs: ms(t7.Sub(times.t4)),
+		TotalMs:    ms(t7.Sub(times.t0)),
+
+		T0: nanos(times.t0),
+		T1: nanos(times.t1),
+		T2: nanos(times.t2),
+		T3: nanos(times.t3),
+		T4: nanos(times.t4),
+		T5: nanos(times.t5),
+		T6: nanos(times.t6),
+		T7: nanos(t7),
+	}
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	default:
+		return fmt.Sprintf("0x%04x", version)
+	}
+}
+
+// renderResult marshals r per --output-format (json or ndjson) to stdout.
+// ndjson differs from json only in that it is not indented, so each result
+// (e.g. one per ping-mode iteration) is a single line.
+func renderResult(r Result) {
+	switch outputFormat {
+	case "ndjson":
+		b, err := json.Marshal(r)
+		if err != nil {
+			logger.Error("unable to marshal result: %v", err)
+			return
+		}
+		fmt.Println(string(b))
+	default: // json
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			logger.Error("unable to marshal result: %v", err)
+			return
+		}
+		fmt.Println(string(b))
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kuangcp/logger"
+)
+
+// tofuPin is one "trust on first use" record: the SHA-256 of a host's leaf
+// certificate SPKI, and that certificate's expiry, as last observed.
+type tofuPin struct {
+	fingerprint string
+	notAfter    time.Time
+}
+
+// TOFUStatus is the outcome of one TOFU pin check, for the --output-format
+// json/ndjson sinks (the text sink gets the same information from the
+// "TOFU:"/"POSSIBLE MITM" lines tofuVerifyPeerCertificate prints).
+type TOFUStatus struct {
+	Hostport    string `json:"hostport"`
+	Status      string `json:"status"` // "pinned" (first use) or "matched"
+	Fingerprint string `json:"fingerprint"`
+	NotAfter    string `json:"not_after,omitempty"`
+}
+
+// tofuFilePath returns the path of the pin store: --tofu-file if given,
+// otherwise $XDG_DATA_HOME/httpstat/tofu.txt (falling back to
+// ~/.local/share when XDG_DATA_HOME is unset).
+func tofuFilePath() string {
+	if tofuFile != "" {
+		return tofuFile
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			logger.Fatal("unable to determine home directory for TOFU store: %v", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "httpstat", "tofu.txt")
+}
+
+// loadTofuPins reads the pin store, one "hostport sha256hex notAfterUnix"
+// line per entry. A missing file is treated as an empty store.
+func loadTofuPins(path string) map[string]tofuPin {
+	pins := map[string]tofuPin{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("unable to read TOFU store %s: %v", path, err)
+		}
+		return pins
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		notAfterUnix, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		pins[fields[0]] = tofuPin{fingerprint: fields[1], notAfter: time.Unix(notAfterUnix, 0)}
+	}
+	return pins
+}
+
+// saveTofuPins rewrites the pin store at path with the given pins, sorted by
+// hostport for a stable diff.
+func saveTofuPins(path string, pins map[string]tofuPin) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		logger.Error("unable to create TOFU store directory: %v", err)
+		return
+	}
+
+	hostports := make([]string, 0, len(pins))
+	for hostport := range pins {
+		hostports = append(hostports, hostport)
+	}
+	sort.Strings(hostports)
+
+	var b strings.Builder
+	for _, hostport := range hostports {
+		pin := pins[hostport]
+		fmt.Fprintf(&b, "%s %s %d\n", hostport, pin.fingerprint, pin.notAfter.Unix())
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		logger.Error("unable to write TOFU store %s: %v", path, err)
+	}
+}
+
+// spkiFingerprint returns the hex-encoded SHA-256 of a certificate's
+// subject public key info, which is what gets pinned (it survives
+// certificate renewal with the same key, unlike a whole-cert fingerprint).
+func spkiFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// tofuVerifyPeerCertificate builds a tls.Config.VerifyPeerCertificate callback
+// for hostport. It is the sole authority on trust (InsecureSkipVerify is set
+// alongside it): on first contact it pins the leaf certificate's SPKI
+// fingerprint, on later contacts it rejects the handshake if the fingerprint
+// has changed, printing both fingerprints and the observed cert's identity.
+// The text-mode "TOFU:"/"POSSIBLE MITM" lines are only printed for
+// --output-format text, since they'd otherwise interleave with and corrupt
+// the json/ndjson sinks; status, if non-nil, is filled in instead so those
+// sinks can still report the pin outcome as part of the Result.
+func tofuVerifyPeerCertificate(hostport string, status *TOFUStatus) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("tofu: server presented no certificates")
+		}
+
+		leaf, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("tofu: unable to parse leaf certificate: %w", err)
+		}
+
+		path := tofuFilePath()
+		pins := loadTofuPins(path)
+		observed := spkiFingerprint(leaf)
+
+		verbose := outputFormat == "text"
+
+		pin, known := pins[hostport]
+		switch {
+		case !known:
+			pins[hostport] = tofuPin{fingerprint: observed, notAfter: leaf.NotAfter}
+			saveTofuPins(path, pins)
+			if verbose {
+				printf("\n%s %s\n", color.GreenString("TOFU:"), color.CyanString("pinned new certificate for %s (%s)", hostport, observed))
+			}
+			if status != nil {
+				*status = TOFUStatus{Hostport: hostport, Status: "pinned", Fingerprint: observed, NotAfter: leaf.NotAfter.Format(time.RFC3339)}
+			}
+
+		case pin.fingerprint == observed:
+			if verbose {
+				printf("\n%s %s\n", color.GreenString("TOFU:"), color.CyanString("certificate matches pin for %s, expires %s", hostport, formatExpiry(leaf.NotAfter)))
+			}
+			if status != nil {
+				*status = TOFUStatus{Hostport: hostport, Status: "matched", Fingerprint: observed, NotAfter: leaf.NotAfter.Format(time.RFC3339)}
+			}
+
+		default:
+			if verbose {
+				printf("\n%s\n", color.New(color.FgWhite, color.BgRed, color.Bold).Sprint(" POSSIBLE MITM: certificate fingerprint changed! "))
+				printf("  host:       %s\n", hostport)
+				printf("  pinned:     %s\n", pin.fingerprint)
+				printf("  observed:   %s\n", observed)
+				printf("  subject:    %s\n", leaf.Subject)
+				printf("  issuer:     %s\n", leaf.Issuer)
+				printf("  SANs:       %s\n", strings.Join(leaf.DNSNames, ", "))
+			}
+			return fmt.Errorf("tofu: certificate fingerprint for %s changed from %s to %s", hostport, pin.fingerprint, observed)
+		}
+
+		return nil
+	}
+}
+
+func formatExpiry(notAfter time.Time) string {
+	remaining := time.Until(notAfter)
+	if remaining < 0 {
+		return fmt.Sprintf("%s (expired)", notAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (in %d days)", notAfter.Format(time.RFC3339), int(remaining.Hours()/24))
+}
+
+// resetTofuPin implements --tofu-reset: it forgets the pinned fingerprint for
+// the given host[:port], if one exists.
+func resetTofuPin(host string) {
+	hostport := host
+	if !strings.Contains(hostport, ":") {
+		hostport = hostport + ":443"
+	}
+
+	path := tofuFilePath()
+	pins := loadTofuPins(path)
+	if _, ok := pins[hostport]; !ok {
+		printf("no TOFU pin found for %s\n", hostport)
+		return
+	}
+
+	delete(pins, hostport)
+	saveTofuPins(path, pins)
+	printf("removed TOFU pin for %s\n", hostport)
+}